@@ -0,0 +1,280 @@
+package dht
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/lukesolo/go-libp2p-kad-dht/metrics"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// HandlerPolicy tunes the admission-control layer wrapped around every
+// dhtHandler. It is passed to New so operators can adjust it per
+// deployment without touching this package.
+type HandlerPolicy struct {
+	// Rate is the steady-state number of requests per second a single
+	// remote peer is allowed to make of a single message type.
+	Rate float64
+	// Burst is the token bucket size, i.e. how many requests a peer can
+	// make in a burst before being throttled back down to Rate.
+	Burst float64
+	// MaxConcurrent bounds how many requests (of any type, from any peer)
+	// may be in flight inside the handlers at once.
+	MaxConcurrent int
+	// MisbehaviorPenalty is subtracted from a peer's bucket, across all
+	// of its message types, every time it's caught sending something
+	// invalid: a bad provider signature, a record that fails
+	// Validator.Validate, a provider record whose originator doesn't
+	// match the sender, or a GET_PROVIDERS fan-out past ProviderLookupFanout.
+	MisbehaviorPenalty float64
+	// ProviderLookupFanout bounds how many distinct keys a single peer
+	// may GET_PROVIDERS for within FetchedKeyTTL before it's penalized.
+	// A client resolving content it cares about looks up a handful of
+	// CIDs; past this many distinct keys the pattern looks like scraping
+	// the provider table rather than resolving anything in particular.
+	ProviderLookupFanout int
+	// FetchedKeyTTL bounds how long a GET_VALUE key or GET_PROVIDERS
+	// fan-out entry is remembered before being evicted, and how idle a
+	// peer's token buckets can go before they're dropped too.
+	FetchedKeyTTL time.Duration
+}
+
+// DefaultHandlerPolicy is used by New when no HandlerPolicy is supplied.
+var DefaultHandlerPolicy = HandlerPolicy{
+	Rate:                 20,
+	Burst:                40,
+	MaxConcurrent:        256,
+	MisbehaviorPenalty:   10,
+	ProviderLookupFanout: 128,
+	FetchedKeyTTL:        30 * time.Minute,
+}
+
+// admissionController is the token-bucket-per-(peer, message type)
+// admission layer wrapped around handlerForMsgType's output.
+type admissionController struct {
+	policy HandlerPolicy
+
+	mu              sync.Mutex
+	buckets         map[peer.ID]map[pb.Message_MessageType]*tokenBucket
+	fetched         map[peer.ID]map[string]time.Time
+	providerLookups map[peer.ID]map[string]time.Time
+
+	evictions uint32
+
+	sem chan struct{}
+}
+
+func newAdmissionController(policy HandlerPolicy) *admissionController {
+	if policy.MaxConcurrent <= 0 {
+		policy.MaxConcurrent = DefaultHandlerPolicy.MaxConcurrent
+	}
+	if policy.ProviderLookupFanout <= 0 {
+		policy.ProviderLookupFanout = DefaultHandlerPolicy.ProviderLookupFanout
+	}
+	if policy.FetchedKeyTTL <= 0 {
+		policy.FetchedKeyTTL = DefaultHandlerPolicy.FetchedKeyTTL
+	}
+	return &admissionController{
+		policy:          policy,
+		buckets:         make(map[peer.ID]map[pb.Message_MessageType]*tokenBucket),
+		fetched:         make(map[peer.ID]map[string]time.Time),
+		providerLookups: make(map[peer.ID]map[string]time.Time),
+		sem:             make(chan struct{}, policy.MaxConcurrent),
+	}
+}
+
+// RecordFetch remembers that p legitimately asked us for k via GET_VALUE.
+func (ac *admissionController) RecordFetch(p peer.ID, k []byte) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := time.Now()
+	ac.maybeEvict(now)
+
+	keys, ok := ac.fetched[p]
+	if !ok {
+		keys = make(map[string]time.Time)
+		ac.fetched[p] = keys
+	}
+	keys[string(k)] = now
+}
+
+// RecordProviderLookup remembers that p asked GET_PROVIDERS for k, and
+// reports whether p has now made more distinct GET_PROVIDERS requests
+// within policy.FetchedKeyTTL than policy.ProviderLookupFanout allows.
+// A key p has already fetched via GET_VALUE (see RecordFetch) is not
+// counted and never trips the fan-out.
+func (ac *admissionController) RecordProviderLookup(p peer.ID, k []byte) bool {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	now := time.Now()
+	ac.maybeEvict(now)
+
+	if _, ok := ac.fetched[p][string(k)]; ok {
+		return false
+	}
+
+	keys, ok := ac.providerLookups[p]
+	if !ok {
+		keys = make(map[string]time.Time)
+		ac.providerLookups[p] = keys
+	}
+	keys[string(k)] = now
+
+	return len(keys) > ac.policy.ProviderLookupFanout
+}
+
+// maybeEvict drops fetched/providerLookups entries and token buckets that
+// haven't been touched within policy.FetchedKeyTTL, so a churning peer
+// population or a peer hammering us with any single message type doesn't
+// grow these maps forever. It's called from bucketFor, so every message
+// type drives the sweep, not just GET_VALUE/GET_PROVIDERS; it's amortized
+// to run every 256 calls rather than on every request. Callers must hold
+// ac.mu.
+func (ac *admissionController) maybeEvict(now time.Time) {
+	ac.evictions++
+	if ac.evictions%256 != 0 {
+		return
+	}
+
+	cutoff := now.Add(-ac.policy.FetchedKeyTTL)
+	for p, keys := range ac.fetched {
+		for k, t := range keys {
+			if t.Before(cutoff) {
+				delete(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			delete(ac.fetched, p)
+		}
+	}
+	for p, keys := range ac.providerLookups {
+		for k, t := range keys {
+			if t.Before(cutoff) {
+				delete(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			delete(ac.providerLookups, p)
+		}
+	}
+	for p, perType := range ac.buckets {
+		for t, b := range perType {
+			if b.last.Before(cutoff) {
+				delete(perType, t)
+			}
+		}
+		if len(perType) == 0 {
+			delete(ac.buckets, p)
+		}
+	}
+}
+
+// tokenBucket is a minimal, mutex-free token bucket; callers take the
+// admissionController lock around it instead, since buckets are looked
+// up through the same map.
+type tokenBucket struct {
+	tokens     float64
+	maxTokens  float64
+	refillRate float64 // tokens per second
+	last       time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, cost float64) bool {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = minFloat(b.maxTokens, b.tokens+elapsed*b.refillRate)
+		b.last = now
+	}
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (ac *admissionController) bucketFor(p peer.ID, t pb.Message_MessageType, now time.Time) *tokenBucket {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.maybeEvict(now)
+
+	perPeer, ok := ac.buckets[p]
+	if !ok {
+		perPeer = make(map[pb.Message_MessageType]*tokenBucket)
+		ac.buckets[p] = perPeer
+	}
+
+	b, ok := perPeer[t]
+	if !ok {
+		b = &tokenBucket{tokens: ac.policy.Burst, maxTokens: ac.policy.Burst, refillRate: ac.policy.Rate, last: now}
+		perPeer[t] = b
+	}
+	return b
+}
+
+// Penalize decays every bucket belonging to p by policy.MisbehaviorPenalty,
+// in response to observed bad behavior (signature failures, records that
+// fail validation, provider/originator mismatches, speculative
+// GET_PROVIDERS). It is called from the handlers themselves, not from
+// wrap, since only they know whether a given request turned out bad.
+func (ac *admissionController) Penalize(p peer.ID) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	for _, b := range ac.buckets[p] {
+		b.tokens -= ac.policy.MisbehaviorPenalty
+		if b.tokens < 0 {
+			b.tokens = 0
+		}
+	}
+}
+
+// wrap enforces the token bucket for (p, t) and the global concurrency
+// semaphore around h, short-circuiting with a RATE_LIMITED response
+// (see pb.Message's new status field) instead of running h when either
+// is exhausted.
+func (ac *admissionController) wrap(t pb.Message_MessageType, h dhtHandler) dhtHandler {
+	return func(ctx context.Context, p peer.ID, req *pb.Message) (*pb.Message, error) {
+		start := time.Now()
+		ctxTags, _ := tag.New(ctx, metrics.UpsertMessageType(req), tag.Upsert(metrics.KeyPeerID, p.Pretty()))
+
+		select {
+		case ac.sem <- struct{}{}:
+			defer func() { <-ac.sem }()
+		default:
+			stats.Record(ctxTags, metrics.DroppedByRateLimit.M(1))
+			return rateLimitedResponse(req), nil
+		}
+
+		if !ac.bucketFor(p, t, start).take(start, 1) {
+			stats.Record(ctxTags, metrics.DroppedByRateLimit.M(1))
+			return rateLimitedResponse(req), nil
+		}
+
+		resp, err := h(ctx, p, req)
+		stats.Record(ctxTags, metrics.AdmissionLatency.M(float64(time.Since(start).Milliseconds())))
+		return resp, err
+	}
+}
+
+// rateLimitedResponse builds the wire-level response a well-behaved
+// client should back off on, rather than hanging waiting for a reply
+// that will never arrive.
+func rateLimitedResponse(req *pb.Message) *pb.Message {
+	resp := pb.NewMessage(req.GetType(), req.GetKey(), req.GetClusterLevel())
+	resp.Status = pb.Message_RATE_LIMITED
+	return resp
+}
@@ -0,0 +1,46 @@
+package dht
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 2, maxTokens: 2, refillRate: 1, last: now}
+
+	if !b.take(now, 1) {
+		t.Fatal("expected first take to succeed")
+	}
+	if !b.take(now, 1) {
+		t.Fatal("expected second take to succeed")
+	}
+	if b.take(now, 1) {
+		t.Fatal("expected third take to fail, bucket should be empty")
+	}
+
+	later := now.Add(2 * time.Second)
+	if !b.take(later, 1) {
+		t.Fatal("expected take to succeed after refill")
+	}
+}
+
+func TestRecordProviderLookupFanout(t *testing.T) {
+	policy := DefaultHandlerPolicy
+	policy.ProviderLookupFanout = 2
+	ac := newAdmissionController(policy)
+
+	p := peer.ID("test-peer")
+
+	if ac.RecordProviderLookup(p, []byte("a")) {
+		t.Fatal("did not expect fanout to trip on 1st distinct key")
+	}
+	if ac.RecordProviderLookup(p, []byte("b")) {
+		t.Fatal("did not expect fanout to trip on 2nd distinct key")
+	}
+	if !ac.RecordProviderLookup(p, []byte("c")) {
+		t.Fatal("expected fanout to trip on 3rd distinct key")
+	}
+}
@@ -0,0 +1,108 @@
+package dht
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	ds "github.com/ipfs/go-datastore"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+	"github.com/lukesolo/go-libp2p-kad-dht/providers"
+)
+
+// KValue is the Kademlia system-wide replication parameter.
+const KValue = 20
+
+// MaxRecordAge is the max time a DHT record is "valid" for, after which
+// it's considered stale and evicted on next read.
+const MaxRecordAge = 36 * time.Hour
+
+// IpfsDHT is a Kademlia-style distributed hash table over an existing
+// libp2p host. It handles PUT_VALUE/GET_VALUE, ADD_PROVIDER/GET_PROVIDERS
+// and FIND_NODE/PING, plus the S/Kademlia and custom-message-type
+// extensions layered on top in this package.
+type IpfsDHT struct {
+	self      peer.ID
+	host      host.Host
+	peerstore peerstore.Peerstore
+	datastore ds.Datastore
+
+	Validator Validator
+
+	routingTable *kb.RoutingTable
+
+	providers providers.ProviderManager
+
+	// AcceptUnsignedProviderRecords is a rollout flag: true accepts
+	// ADD_PROVIDER records with no signature, false rejects them. See
+	// handleAddProvider.
+	AcceptUnsignedProviderRecords bool
+
+	siblings *siblingList
+
+	// PeerIDVerifier checks a peer ID offered in a lookup response
+	// before it's added to that lookup's frontier.
+	PeerIDVerifier PeerIDVerifier
+
+	hooksMu           sync.RWMutex
+	customHandlers    map[pb.Message_MessageType]dhtHandler
+	beforeHandleHooks []BeforeHandle
+	afterHandleHooks  []AfterHandle
+
+	admission *admissionController
+
+	republisher *provideRepublisher
+
+	stripedPutLocks [256]sync.Mutex
+}
+
+// New constructs an IpfsDHT over h, storing records and provider records
+// in dstore. policy tunes the admission-control layer; pass
+// DefaultHandlerPolicy if unsure.
+func New(h host.Host, dstore ds.Datastore, validator Validator, policy HandlerPolicy) *IpfsDHT {
+	self := h.ID()
+
+	dht := &IpfsDHT{
+		self:                          self,
+		host:                          h,
+		peerstore:                     h.Peerstore(),
+		datastore:                     dstore,
+		Validator:                     validator,
+		providers:                     providers.NewProviderManager(self, dstore),
+		AcceptUnsignedProviderRecords: true,
+		siblings:                      newSiblingList(self, DefaultSiblingListSize),
+		customHandlers:                make(map[pb.Message_MessageType]dhtHandler),
+		admission:                     newAdmissionController(policy),
+	}
+
+	dht.routingTable = kb.NewRoutingTable(KValue, kb.ConvertPeerID(self), time.Hour, h.Peerstore())
+	dht.routingTable.PeerAdded = dht.siblings.Add
+	dht.routingTable.PeerRemoved = dht.siblings.Remove
+
+	dht.PeerIDVerifier = DefaultPeerIDVerifier(h.Peerstore())
+	dht.republisher = newProvideRepublisher(dht)
+
+	h.SetStreamHandler(ProtocolDHT, dht.handleStream)
+
+	return dht
+}
+
+// betterPeersToQuery returns up to count peers from the routing table
+// nearest to pmes's key, excluding dht.self and p (the peer that sent us
+// the request) so we never just echo a request back. The peers are not
+// checked to be closer to the key than dht.self is.
+func (dht *IpfsDHT) betterPeersToQuery(pmes *pb.Message, p peer.ID, count int) []peer.ID {
+	closer := dht.routingTable.NearestPeers(kb.ConvertKey(string(pmes.GetKey())), count)
+
+	filtered := make([]peer.ID, 0, len(closer))
+	for _, c := range closer {
+		if c == p || c == dht.self {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
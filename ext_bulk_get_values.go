@@ -0,0 +1,45 @@
+package dht
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+)
+
+// MessageTypeGetValues is a reference extension built on RegisterHandler:
+// a batched GET_VALUE that looks up several keys in one round trip. It
+// exists to demonstrate the custom message type API and to give clients
+// that need many records at once (e.g. resolving a whole DAG's worth of
+// IPNS names) a way to avoid paying a round trip per key.
+const MessageTypeGetValues pb.Message_MessageType = MinCustomMessageType
+
+// RegisterBulkGetValues installs the MessageTypeGetValues handler on dht.
+// Call it once during setup; it is not registered by default so that
+// nodes which don't want the extra message type don't pay for it.
+func (dht *IpfsDHT) RegisterBulkGetValues() error {
+	return dht.RegisterHandler(MessageTypeGetValues, dht.handleGetValues)
+}
+
+// handleGetValues answers a batched lookup by running the same local
+// datastore check handleGetValue does for each requested key, packing
+// the results into BulkRecords in request order. A missing record is
+// represented by a nil entry at the same index rather than by shrinking
+// the slice, so callers can still line responses up with their request.
+func (dht *IpfsDHT) handleGetValues(ctx context.Context, p peer.ID, pmes *pb.Message) (*pb.Message, error) {
+	resp := pb.NewMessage(MessageTypeGetValues, nil, pmes.GetClusterLevel())
+
+	keys := pmes.GetBulkKeys()
+	records := make([]*recpb.Record, 0, len(keys))
+	for _, k := range keys {
+		rec, err := dht.checkLocalDatastore(k)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	resp.BulkRecords = records
+	return resp, nil
+}
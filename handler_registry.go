@@ -0,0 +1,102 @@
+package dht
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+)
+
+// MinCustomMessageType is the first pb.Message_MessageType value reserved
+// for application-defined RPCs. Everything below it is reserved for this
+// package's own built-in message types (the six in use today and room
+// for future ones, see pb/dht.proto); RegisterHandler refuses
+// anything below this so a downstream project can never accidentally
+// shadow a built-in handler.
+const MinCustomMessageType pb.Message_MessageType = 100
+
+// ErrReservedMessageType is returned by RegisterHandler when asked to
+// register a message type below MinCustomMessageType.
+var ErrReservedMessageType = fmt.Errorf("message types below %d are reserved for the built-in DHT protocol", int32(MinCustomMessageType))
+
+// ErrHandlerAlreadyRegistered is returned by RegisterHandler when a
+// handler is already installed for msgType.
+var ErrHandlerAlreadyRegistered = fmt.Errorf("a handler is already registered for this message type")
+
+// BeforeHandle runs before a dhtHandler is invoked and may return an
+// error to short-circuit the request (e.g. per-peer rate limiting or
+// authentication). It is suitable for tagging the opencensus context
+// used elsewhere in the metrics package.
+type BeforeHandle func(ctx context.Context, p peer.ID, req *pb.Message) error
+
+// AfterHandle runs once a dhtHandler has returned, regardless of error,
+// and is suitable for tracing or metering.
+type AfterHandle func(ctx context.Context, p peer.ID, req *pb.Message, resp *pb.Message, err error)
+
+// RegisterHandler installs h as the handler for msgType, letting
+// downstream projects layer their own RPCs over this package's existing
+// stream/protocol ID instead of forking it. msgType must be
+// >= MinCustomMessageType.
+func (dht *IpfsDHT) RegisterHandler(msgType pb.Message_MessageType, h dhtHandler) error {
+	if msgType < MinCustomMessageType {
+		return ErrReservedMessageType
+	}
+
+	dht.hooksMu.Lock()
+	defer dht.hooksMu.Unlock()
+
+	if dht.customHandlers == nil {
+		dht.customHandlers = make(map[pb.Message_MessageType]dhtHandler)
+	}
+	if _, exists := dht.customHandlers[msgType]; exists {
+		return ErrHandlerAlreadyRegistered
+	}
+
+	dht.customHandlers[msgType] = h
+	return nil
+}
+
+// AddBeforeHandleHook registers a hook run before every handler dispatch,
+// built-in or custom, in the order it was added. Any error returned by a
+// hook aborts dispatch and is returned to the caller in place of running
+// the handler.
+func (dht *IpfsDHT) AddBeforeHandleHook(hook BeforeHandle) {
+	dht.hooksMu.Lock()
+	defer dht.hooksMu.Unlock()
+	dht.beforeHandleHooks = append(dht.beforeHandleHooks, hook)
+}
+
+// AddAfterHandleHook registers a hook run after every handler dispatch,
+// built-in or custom, in the order it was added.
+func (dht *IpfsDHT) AddAfterHandleHook(hook AfterHandle) {
+	dht.hooksMu.Lock()
+	defer dht.hooksMu.Unlock()
+	dht.afterHandleHooks = append(dht.afterHandleHooks, hook)
+}
+
+// wrapWithInterceptors runs h through the registered Before/AfterHandle
+// hooks. handlerForMsgType applies it to every message type, built-in or
+// custom, so both get identical rate limiting, auth and tracing behaviour.
+func (dht *IpfsDHT) wrapWithInterceptors(msgType pb.Message_MessageType, h dhtHandler) dhtHandler {
+	return func(ctx context.Context, p peer.ID, req *pb.Message) (*pb.Message, error) {
+		dht.hooksMu.RLock()
+		before := append([]BeforeHandle(nil), dht.beforeHandleHooks...)
+		after := append([]AfterHandle(nil), dht.afterHandleHooks...)
+		dht.hooksMu.RUnlock()
+
+		for _, hook := range before {
+			if err := hook(ctx, p, req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := h(ctx, p, req)
+
+		for _, hook := range after {
+			hook(ctx, p, req, resp, err)
+		}
+
+		return resp, err
+	}
+}
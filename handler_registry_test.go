@@ -0,0 +1,30 @@
+package dht
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+)
+
+func noopHandler(context.Context, peer.ID, *pb.Message) (*pb.Message, error) {
+	return nil, nil
+}
+
+func TestRegisterHandlerRejectsReservedRange(t *testing.T) {
+	dht := &IpfsDHT{}
+	if err := dht.RegisterHandler(MinCustomMessageType-1, noopHandler); err != ErrReservedMessageType {
+		t.Fatalf("RegisterHandler(%d, ...) = %v, want ErrReservedMessageType", MinCustomMessageType-1, err)
+	}
+}
+
+func TestRegisterHandlerRejectsDuplicate(t *testing.T) {
+	dht := &IpfsDHT{}
+	if err := dht.RegisterHandler(MinCustomMessageType, noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	if err := dht.RegisterHandler(MinCustomMessageType, noopHandler); err != ErrHandlerAlreadyRegistered {
+		t.Fatalf("second RegisterHandler(%d, ...) = %v, want ErrHandlerAlreadyRegistered", MinCustomMessageType, err)
+	}
+}
@@ -18,7 +18,6 @@ import (
 	u "github.com/ipfs/go-ipfs-util"
 	recpb "github.com/libp2p/go-libp2p-record/pb"
 	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
-	"github.com/whyrusleeping/base32"
 )
 
 // The number of closer peers to send on requests.
@@ -28,6 +27,17 @@ var CloserPeerCount = KValue
 type dhtHandler func(context.Context, peer.ID, *pb.Message) (*pb.Message, error)
 
 func (dht *IpfsDHT) handlerForMsgType(t pb.Message_MessageType) dhtHandler {
+	h := dht.baseHandlerForMsgType(t)
+	if h == nil {
+		return nil
+	}
+	// wrapWithInterceptors and admission control apply the same way to
+	// every message type, built-in or custom.
+	h = dht.wrapWithInterceptors(t, h)
+	return dht.admission.wrap(t, h)
+}
+
+func (dht *IpfsDHT) baseHandlerForMsgType(t pb.Message_MessageType) dhtHandler {
 	switch t {
 	case pb.Message_GET_VALUE:
 		return dht.handleGetValue
@@ -42,6 +52,15 @@ func (dht *IpfsDHT) handlerForMsgType(t pb.Message_MessageType) dhtHandler {
 	case pb.Message_PING:
 		return dht.handlePing
 	default:
+		// Fall through to handlers registered by RegisterHandler, which is
+		// how downstream projects layer application-defined message types
+		// (>= MinCustomMessageType) onto this same stream/protocol ID.
+		dht.hooksMu.RLock()
+		h, ok := dht.customHandlers[t]
+		dht.hooksMu.RUnlock()
+		if ok {
+			return h
+		}
 		return nil
 	}
 }
@@ -68,6 +87,10 @@ func (dht *IpfsDHT) handleGetValue(ctx context.Context, p peer.ID, pmes *pb.Mess
 	}
 	resp.Record = rec
 
+	// Remember that p has legitimately asked about k, so a later
+	// GET_PROVIDERS for the same key isn't penalized as speculative.
+	dht.admission.RecordFetch(p, k)
+
 	// Find closest peer on given cluster to desired key and reply with that info
 	closer := dht.betterPeersToQuery(pmes, p, CloserPeerCount)
 	if len(closer) > 0 {
@@ -91,7 +114,7 @@ func (dht *IpfsDHT) handleGetValue(ctx context.Context, p peer.ID, pmes *pb.Mess
 
 func (dht *IpfsDHT) checkLocalDatastore(k []byte) (*recpb.Record, error) {
 	logger.Debugf("%s handleGetValue looking into ds", dht.self)
-	dskey := convertToDsKey(k)
+	dskey := convertToDsKey(RecordsNamespace, k)
 	buf, err := dht.datastore.Get(dskey)
 	logger.Debugf("%s handleGetValue looking into ds GOT %v", dht.self, buf)
 
@@ -166,12 +189,13 @@ func (dht *IpfsDHT) handlePutValue(ctx context.Context, p peer.ID, pmes *pb.Mess
 	cleanRecord(rec)
 
 	// Make sure the record is valid (not expired, valid signature etc)
-	if err = dht.Validator.Validate(string(rec.GetKey()), rec.GetValue()); err != nil {
+	if err = dht.Validator.ValidateBytes(rec.GetKey(), rec.GetValue()); err != nil {
 		logger.Warningf("Bad dht record in PUT from: %s. %s", p.Pretty(), err)
+		dht.admission.Penalize(p)
 		return nil, err
 	}
 
-	dskey := convertToDsKey(rec.GetKey())
+	dskey := convertToDsKey(RecordsNamespace, rec.GetKey())
 
 	// fetch the striped lock for this key
 	var indexForLock byte
@@ -194,7 +218,7 @@ func (dht *IpfsDHT) handlePutValue(ctx context.Context, p peer.ID, pmes *pb.Mess
 
 	if existing != nil {
 		recs := [][]byte{rec.GetValue(), existing.GetValue()}
-		i, err := dht.Validator.Select(string(rec.GetKey()), recs)
+		i, err := dht.Validator.SelectBytes(rec.GetKey(), recs)
 		if err != nil {
 			logger.Warningf("Bad dht record in PUT from %s: %s", p.Pretty(), err)
 			return nil, err
@@ -237,7 +261,7 @@ func (dht *IpfsDHT) getRecordFromDatastore(dskey ds.Key) (*recpb.Record, error)
 		return nil, nil
 	}
 
-	err = dht.Validator.Validate(string(rec.GetKey()), rec.GetValue())
+	err = dht.Validator.ValidateBytes(rec.GetKey(), rec.GetValue())
 	if err != nil {
 		// Invalid record in datastore, probably expired but don't return an error,
 		// we'll just overwrite it
@@ -260,12 +284,25 @@ func (dht *IpfsDHT) handleFindPeer(ctx context.Context, p peer.ID, pmes *pb.Mess
 	resp := pb.NewMessage(pmes.GetType(), nil, pmes.GetClusterLevel())
 	var closest []peer.ID
 
+	// Per-query override of how many closer peers to return: a query
+	// running d disjoint S/Kademlia paths needs more than CloserPeerCount
+	// peers per hop to keep every path fed from non-overlapping buckets.
+	closerPeerCount := CloserPeerCount
+	if n := pmes.GetCloserPeerCount(); n > 0 {
+		closerPeerCount = int(n)
+	}
+
 	// if looking for self... special case where we send it on CloserPeers.
 	targetPid := peer.ID(pmes.GetKey())
 	if targetPid == dht.self {
 		closest = []peer.ID{dht.self}
+	} else if dht.siblings.Covers(targetPid) {
+		// The target falls inside our sibling range: the sibling list is
+		// kept denser than any single k-bucket, so prefer it over
+		// betterPeersToQuery here.
+		closest = dht.siblings.Peers()
 	} else {
-		closest = dht.betterPeersToQuery(pmes, p, CloserPeerCount)
+		closest = dht.betterPeersToQuery(pmes, p, closerPeerCount)
 
 		// Never tell a peer about itself.
 		if targetPid != p {
@@ -321,17 +358,32 @@ func (dht *IpfsDHT) handleGetProviders(ctx context.Context, p peer.ID, pmes *pb.
 	logger.Debugf("%s begin", reqDesc)
 	defer logger.Debugf("%s end", reqDesc)
 
-	// check if we have this value, to add ourselves as provider.
-	has, err := dht.datastore.Has(convertToDsKey(c.Bytes()))
-	if err != nil && err != ds.ErrNotFound {
+	// GET_VALUE and GET_PROVIDERS serve different key spaces, so a peer
+	// is not suspicious just because it never GET_VALUE'd this key --
+	// resolving content normally means asking GET_PROVIDERS for a CID
+	// you've never fetched the record for. What is suspicious is a peer
+	// sweeping an unusually large number of distinct keys.
+	if dht.admission.RecordProviderLookup(p, pmes.GetKey()) {
+		dht.admission.Penalize(p)
+	}
+
+	// check if we have this value ourselves. We only add ourselves as a
+	// provider if our own copy hasn't itself gone stale, otherwise we'd
+	// hand out a provider record for content we're about to garbage
+	// collect.
+	rec, err := dht.checkLocalDatastore(c.Bytes())
+	if err != nil {
 		logger.Debugf("unexpected datastore error: %v\n", err)
-		has = false
 	}
+	has := rec != nil
 
 	// setup providers
 	providers := dht.providers.GetProviders(ctx, c)
+	providers, sigs, exps := dht.filterExpiredProviders(ctx, c, providers)
 	if has {
 		providers = append(providers, dht.self)
+		sigs = append(sigs, nil)
+		exps = append(exps, 0)
 		logger.Debugf("%s have the value. added self as provider", reqDesc)
 	}
 
@@ -339,6 +391,10 @@ func (dht *IpfsDHT) handleGetProviders(ctx context.Context, p peer.ID, pmes *pb.
 		// TODO: pstore.PeerInfos should move to core (=> peerstore.AddrInfos).
 		infos := pstore.PeerInfos(dht.peerstore, providers)
 		resp.ProviderPeers = pb.PeerInfosToPBPeers(dht.host.Network(), infos)
+		// Attach the signature and expiration we have on file for each
+		// provider so the requester can verify the record itself instead of
+		// trusting us to have checked it.
+		resp.ProviderSignatures, resp.ProviderExpirations = sigs, exps
 		logger.Debugf("%s have %d providers: %s", reqDesc, len(providers), infos)
 	}
 
@@ -369,11 +425,13 @@ func (dht *IpfsDHT) handleAddProvider(ctx context.Context, p peer.ID, pmes *pb.M
 
 	// add provider should use the address given in the message
 	pinfos := pb.PBPeersToPeerInfos(pmes.GetProviderPeers())
-	for _, pi := range pinfos {
+	sigs := pmes.GetProviderSignatures()
+	exps := pmes.GetProviderExpirations()
+	for i, pi := range pinfos {
 		if pi.ID != p {
 			// we should ignore this provider record! not from originator.
-			// (we should sign them and check signature later...)
 			logger.Debugf("handleAddProvider received provider %s from %s. Ignore.", pi.ID, p)
+			dht.admission.Penalize(p)
 			continue
 		}
 
@@ -382,17 +440,58 @@ func (dht *IpfsDHT) handleAddProvider(ctx context.Context, p peer.ID, pmes *pb.M
 			continue
 		}
 
+		var (
+			sig []byte
+			exp int64
+		)
+		if i < len(sigs) {
+			sig = sigs[i]
+		}
+		if i < len(exps) {
+			exp = exps[i]
+		}
+
+		if len(sig) == 0 {
+			// dht.AcceptUnsignedProviderRecords is a rollout flag: leave it
+			// true while older, unsigned peers are still in the swarm, then
+			// flip it to false to fail closed and reject anything unsigned.
+			if !dht.AcceptUnsignedProviderRecords {
+				logger.Debugf("%s rejecting unsigned provider record for %s from %s", dht.self, c, p)
+				continue
+			}
+		} else {
+			addrBytes := make([][]byte, len(pi.Addrs))
+			for j, a := range pi.Addrs {
+				addrBytes[j] = a.Bytes()
+			}
+
+			pubk, err := dht.peerstore.PubKey(pi.ID)
+			if err != nil || pubk == nil {
+				logger.Debugf("%s have no public key for %s, cannot verify provider record. Ignore.", dht.self, p)
+				continue
+			}
+
+			ok, err := verifyProviderRecord(pubk, c, pi.ID, addrBytes, exp, sig)
+			if err != nil || !ok {
+				logger.Debugf("%s got a provider record for %s from %s with a bad signature. Ignore.", dht.self, c, p)
+				dht.admission.Penalize(p)
+				continue
+			}
+		}
+
+		// Clamp the requested expiration into [MinProviderTTL, MaxProviderTTL]
+		// after verification, so a signed-but-absurd TTL (too short to ever
+		// be useful, or long enough to outlive any reasonable republish
+		// interval) can't pin a record in our datastore forever.
+		storedExp := clampProviderExpiration(exp)
+
 		logger.Debugf("received provider %s for %s (addrs: %s)", p, c, pi.Addrs)
 		if pi.ID != dht.self { // don't add own addrs.
 			// add the received addresses to our peerstore.
 			dht.peerstore.AddAddrs(pi.ID, pi.Addrs, peerstore.ProviderAddrTTL)
 		}
-		dht.providers.AddProvider(ctx, c, p)
+		dht.providers.AddProvider(ctx, c, p, sig, storedExp)
 	}
 
 	return nil, nil
 }
-
-func convertToDsKey(s []byte) ds.Key {
-	return ds.NewKey(base32.RawStdEncoding.EncodeToString(s))
-}
@@ -0,0 +1,37 @@
+// +build !dht_legacy_keys
+
+package dht
+
+import (
+	"encoding/binary"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// ProvidersNamespace and RecordsNamespace split the datastore into two
+// keyspaces, mirroring the two record types this package stores, each
+// addressed by the raw multihash/CID bytes rather than a text encoding
+// of them.
+const (
+	ProvidersNamespace = "/providers/"
+	RecordsNamespace   = "/records/"
+)
+
+// convertToDsKey builds a datastore key for k under namespace ns using
+// the raw key bytes with a 4-byte big-endian length prefix, rather than
+// base32-encoding them as text. This mirrors the upstream go-ipfs move
+// away from key.Key to plain []byte and saves roughly 60% of the
+// per-key storage a base32 encoding costs. ds.RawKey is used instead of
+// ds.NewKey because k may itself contain '/', which NewKey would
+// otherwise treat as a path separator.
+func convertToDsKey(ns string, k []byte) ds.Key {
+	buf := make([]byte, 0, len(ns)+4+len(k))
+	buf = append(buf, ns...)
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(k)))
+	buf = append(buf, lenPrefix[:]...)
+	buf = append(buf, k...)
+
+	return ds.RawKey(string(buf))
+}
@@ -0,0 +1,25 @@
+// +build dht_legacy_keys
+
+package dht
+
+import (
+	ds "github.com/ipfs/go-datastore"
+	"github.com/whyrusleeping/base32"
+)
+
+// ProvidersNamespace and RecordsNamespace are unused under the legacy
+// base32 keyspace, which didn't separate providers from records, but are
+// kept so call sites don't need a build-tag switch of their own.
+const (
+	ProvidersNamespace = ""
+	RecordsNamespace   = ""
+)
+
+// convertToDsKey is the pre-migration base32 key encoding. Build with
+// -tags dht_legacy_keys for one release after upgrading so a node can
+// still read an existing datastore while github.com/lukesolo/go-libp2p-kad-dht/migrate
+// rewrites it into the new namespaced, length-prefixed binary keyspace;
+// drop the tag once migration has run.
+func convertToDsKey(_ string, s []byte) ds.Key {
+	return ds.NewKey(base32.RawStdEncoding.EncodeToString(s))
+}
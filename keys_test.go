@@ -0,0 +1,21 @@
+// +build !dht_legacy_keys
+
+package dht
+
+import "testing"
+
+func TestConvertToDsKeyRoundTrip(t *testing.T) {
+	k := convertToDsKey(RecordsNamespace, []byte("hello"))
+	if got, want := k.String(), "/records/\x00\x00\x00\x05hello"; got != want {
+		t.Fatalf("convertToDsKey = %q, want %q", got, want)
+	}
+}
+
+func TestConvertToDsKeyDistinctNamespaces(t *testing.T) {
+	k := []byte("same-key")
+	a := convertToDsKey(ProvidersNamespace, k)
+	b := convertToDsKey(RecordsNamespace, k)
+	if a == b {
+		t.Fatal("expected keys under different namespaces to differ")
+	}
+}
@@ -0,0 +1,48 @@
+package dht
+
+import (
+	"context"
+	"fmt"
+	stdlog "log"
+
+	"go.opencensus.io/trace"
+)
+
+// logger is this package's structured logger. Start/SetTag/FinishWithErr
+// lets handlers annotate an opencensus span without each call site
+// pulling in tracing boilerplate directly.
+var logger = &eventLogger{}
+
+type eventLogger struct{}
+
+func (l *eventLogger) Start(ctx context.Context, name string) context.Context {
+	ctx, _ = trace.StartSpan(ctx, name)
+	return ctx
+}
+
+func (l *eventLogger) SetTag(ctx context.Context, key string, value interface{}) {
+	if span := trace.FromContext(ctx); span != nil {
+		span.AddAttributes(trace.StringAttribute(key, fmt.Sprint(value)))
+	}
+}
+
+func (l *eventLogger) FinishWithErr(ctx context.Context, err error) {
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
+
+func (l *eventLogger) Debug(args ...interface{})                 { stdlog.Println(args...) }
+func (l *eventLogger) Debugf(format string, args ...interface{}) { stdlog.Printf(format, args...) }
+func (l *eventLogger) Info(args ...interface{})                  { stdlog.Println(args...) }
+func (l *eventLogger) Infof(format string, args ...interface{})  { stdlog.Printf(format, args...) }
+func (l *eventLogger) Warningf(format string, args ...interface{}) {
+	stdlog.Printf(format, args...)
+}
+func (l *eventLogger) Error(args ...interface{})                 { stdlog.Println(args...) }
+func (l *eventLogger) Errorf(format string, args ...interface{}) { stdlog.Printf(format, args...) }
@@ -0,0 +1,249 @@
+package dht
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+)
+
+// GetClosestPeersDisjoint runs d independent S/Kademlia lookups for key,
+// each seeded from a different, non-overlapping slice of the routing
+// table and forbidden from probing a peer any of the other paths has
+// already visited. A single malicious subtree can eclipse one path, but
+// with routing.table buckets spread across d paths it cannot own enough
+// of the starting material to eclipse all of them at once.
+//
+// The returned peers are the union of what every path converged on,
+// deduplicated and verified with dht.PeerIDVerifier before being handed
+// back to the caller.
+func (dht *IpfsDHT) GetClosestPeersDisjoint(ctx context.Context, key string, d int) ([]peer.ID, error) {
+	if d < 1 {
+		return nil, fmt.Errorf("GetClosestPeersDisjoint: d must be >= 1, got %d", d)
+	}
+
+	starts, err := dht.disjointStartingPeers(d)
+	if err != nil {
+		return nil, err
+	}
+
+	visited := newVisitedSet()
+	results := make([][]peer.ID, d)
+	errs := make([]error, d)
+
+	done := make(chan int, d)
+	for i, seeds := range starts {
+		i, seeds := i, seeds
+		go func() {
+			results[i], errs[i] = dht.runDisjointPath(ctx, key, seeds, d, visited)
+			done <- i
+		}()
+	}
+	for range starts {
+		<-done
+	}
+
+	seen := make(map[peer.ID]struct{})
+	var merged []peer.ID
+	for i, res := range results {
+		if errs[i] != nil {
+			logger.Debugf("%s disjoint path %d for %s failed: %s", dht.self, i, key, errs[i])
+			continue
+		}
+		for _, p := range res {
+			if err := dht.PeerIDVerifier(p); err != nil {
+				logger.Debugf("%s dropping unverifiable peer %s from disjoint lookup: %s", dht.self, p, err)
+				continue
+			}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			merged = append(merged, p)
+		}
+	}
+
+	if len(merged) == 0 && d > 0 {
+		return nil, fmt.Errorf("GetClosestPeersDisjoint: all %d paths failed for key %x", d, key)
+	}
+
+	sortClosest(dht.self, key, merged)
+	return merged, nil
+}
+
+// disjointStartingPeers splits the routing table's buckets into d
+// non-overlapping groups and returns one slice of starting peers per
+// path, so that no two paths begin their walk from the same bucket. A
+// peer's bucket is taken to be its common prefix length with dht.self.
+func (dht *IpfsDHT) disjointStartingPeers(d int) ([][]peer.ID, error) {
+	all := dht.routingTable.ListPeers()
+	if len(all) == 0 {
+		return nil, kb.ErrLookupFailure
+	}
+
+	selfID := kb.ConvertPeerID(dht.self)
+	groups := make([][]peer.ID, d)
+	for _, p := range all {
+		g := kb.CommonPrefixLen(selfID, kb.ConvertPeerID(p)) % d
+		groups[g] = append(groups[g], p)
+	}
+
+	// Backfill any empty group with a peer borrowed from the fullest
+	// group so every path has somewhere to start.
+	for g := range groups {
+		if len(groups[g]) > 0 {
+			continue
+		}
+		fullest := -1
+		for o := range groups {
+			if len(groups[o]) > 1 && (fullest < 0 || len(groups[o]) > len(groups[fullest])) {
+				fullest = o
+			}
+		}
+		if fullest >= 0 {
+			last := len(groups[fullest]) - 1
+			groups[g] = append(groups[g], groups[fullest][last])
+			groups[fullest] = groups[fullest][:last]
+		}
+	}
+
+	return groups, nil
+}
+
+// visitedSet is shared across all disjoint paths of a single lookup so
+// that once one path has queried a peer, no other path will query it
+// again.
+type visitedSet struct {
+	mu      chan struct{}
+	visited map[peer.ID]struct{}
+}
+
+func newVisitedSet() *visitedSet {
+	vs := &visitedSet{mu: make(chan struct{}, 1), visited: make(map[peer.ID]struct{})}
+	vs.mu <- struct{}{}
+	return vs
+}
+
+// TryVisit marks p visited and reports whether this call is the one that
+// did so (i.e. no other path had already visited it).
+func (vs *visitedSet) TryVisit(p peer.ID) bool {
+	<-vs.mu
+	defer func() { vs.mu <- struct{}{} }()
+
+	if _, ok := vs.visited[p]; ok {
+		return false
+	}
+	vs.visited[p] = struct{}{}
+	return true
+}
+
+// disjointAlpha bounds how many unqueried shortlist candidates a single
+// round of runDisjointPath probes concurrently-in-spirit (queried
+// sequentially here, same as the rest of this file).
+const disjointAlpha = 3
+
+// runDisjointPath walks a single S/Kademlia path starting from seeds,
+// using CloserPeerCount-overridden FIND_NODE requests. It keeps a
+// k-sized shortlist and stops once a round of queries against the
+// closest unqueried candidates fails to bring back anything closer,
+// rather than exhausting every peer it can transitively reach. paths is
+// the number of disjoint paths the whole lookup runs.
+func (dht *IpfsDHT) runDisjointPath(ctx context.Context, key string, seeds []peer.ID, paths int, visited *visitedSet) ([]peer.ID, error) {
+	target := kb.ConvertKey(key)
+
+	var shortlist []peer.ID
+	for _, p := range seeds {
+		if visited.TryVisit(p) {
+			shortlist = append(shortlist, p)
+		}
+	}
+
+	queried := make(map[peer.ID]struct{})
+
+	for {
+		kb.SortClosestPeers(shortlist, target)
+		if len(shortlist) > KValue {
+			shortlist = shortlist[:KValue]
+		}
+
+		batch := unqueriedPeers(shortlist, queried, disjointAlpha)
+		if len(batch) == 0 {
+			break
+		}
+		before := append([]peer.ID(nil), shortlist...)
+
+		for _, p := range batch {
+			queried[p] = struct{}{}
+
+			peers, err := dht.findPeerSingle(ctx, p, key, dValuePerPath(paths))
+			if err != nil {
+				continue
+			}
+			for _, np := range peers {
+				if visited.TryVisit(np) {
+					shortlist = append(shortlist, np)
+				}
+			}
+		}
+
+		kb.SortClosestPeers(shortlist, target)
+		if len(shortlist) > KValue {
+			shortlist = shortlist[:KValue]
+		}
+		if samePeers(before, shortlist) {
+			break
+		}
+	}
+
+	return shortlist, nil
+}
+
+// unqueriedPeers returns up to n leading entries of peers not yet present
+// in queried.
+func unqueriedPeers(peers []peer.ID, queried map[peer.ID]struct{}, n int) []peer.ID {
+	out := make([]peer.ID, 0, n)
+	for _, p := range peers {
+		if _, ok := queried[p]; ok {
+			continue
+		}
+		out = append(out, p)
+		if len(out) == n {
+			break
+		}
+	}
+	return out
+}
+
+// samePeers reports whether a and b hold the same peers in the same
+// order.
+func samePeers(a, b []peer.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dValuePerPath derives how many closer peers to ask for per hop so that
+// a lookup running over `paths` disjoint paths still gets k candidates
+// once split across them.
+func dValuePerPath(paths int) int {
+	if paths < 1 {
+		paths = 1
+	}
+	n := (KValue*2 + paths - 1) / paths
+	if n < KValue {
+		n = KValue
+	}
+	return n
+}
+
+// sortClosest orders peers by ascending XOR distance to key.
+func sortClosest(self peer.ID, key string, peers []peer.ID) {
+	kb.SortClosestPeers(peers, kb.ConvertKey(key))
+}
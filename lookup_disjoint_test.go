@@ -0,0 +1,41 @@
+package dht
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestDValuePerPath(t *testing.T) {
+	cases := []struct {
+		paths int
+		want  int
+	}{
+		{paths: 0, want: KValue * 2},
+		{paths: 1, want: KValue * 2},
+		{paths: 2, want: KValue},
+		{paths: 4, want: KValue},
+		{paths: 100, want: KValue},
+	}
+	for _, c := range cases {
+		if got := dValuePerPath(c.paths); got != c.want {
+			t.Errorf("dValuePerPath(%d) = %d, want %d", c.paths, got, c.want)
+		}
+	}
+}
+
+func TestSamePeers(t *testing.T) {
+	a := []peer.ID{"a", "b"}
+	b := []peer.ID{"a", "b"}
+	c := []peer.ID{"a", "c"}
+
+	if !samePeers(a, b) {
+		t.Error("expected equal peer slices to match")
+	}
+	if samePeers(a, c) {
+		t.Error("expected differing peer slices not to match")
+	}
+	if samePeers(a, a[:1]) {
+		t.Error("expected differing lengths not to match")
+	}
+}
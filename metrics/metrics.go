@@ -2,6 +2,7 @@ package metrics
 
 import (
 	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+	"go.opencensus.io/stats"
 	"go.opencensus.io/tag"
 )
 
@@ -14,6 +15,17 @@ var (
 	KeyInstanceID, _ = tag.NewKey("instance_id")
 )
 
+// Measures
+var (
+	// DroppedByRateLimit counts requests admission control rejected
+	// because a peer's token bucket or the global concurrency semaphore
+	// was exhausted.
+	DroppedByRateLimit = stats.Int64("dht/dropped_by_rate_limit", "requests dropped by admission control", stats.UnitDimensionless)
+	// AdmissionLatency records how long a request spent inside a
+	// dhtHandler once admission control let it through.
+	AdmissionLatency = stats.Float64("dht/admission_latency", "handler latency after admission", stats.UnitMilliseconds)
+)
+
 // UpsertMessageType is a convenience upserts the message type
 // of a pb.Message into the KeyMessageType.
 func UpsertMessageType(m *pb.Message) tag.Mutator {
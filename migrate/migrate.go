@@ -0,0 +1,150 @@
+// Package migrate rewrites a DHT datastore from the legacy base32-text
+// keyspace onto the namespaced, length-prefixed binary keyspace
+// introduced alongside dht.convertToDsKey. Run it once, offline, against
+// a node's datastore after upgrading and before dropping the
+// dht_legacy_keys build tag.
+package migrate
+
+import (
+	"encoding/binary"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/whyrusleeping/base32"
+)
+
+// providersNamespace and recordsNamespace must stay in sync with the
+// namespaces dht.ProvidersNamespace and dht.RecordsNamespace use; they're
+// duplicated here rather than imported so this tool keeps working even
+// when built with -tags dht_legacy_keys, under which those constants are
+// blank.
+const (
+	providersNamespace = "/providers/"
+	recordsNamespace   = "/records/"
+)
+
+// RewriteKeyspace walks every key in store's legacy (flat, base32-text)
+// namespace and writes it back out under RecordsNamespace using the new
+// length-prefixed binary encoding, leaving the original entries in place
+// so the migration can be re-run if interrupted. Provider entries live
+// in a separate providers.ProviderManager datastore and are migrated by
+// RewriteProviderKeyspace instead.
+func RewriteKeyspace(store ds.Datastore) (migrated int, err error) {
+	return rewrite(store, recordsNamespace)
+}
+
+// RewriteProviderKeyspace is RewriteKeyspace's counterpart for the
+// provider-record datastore. Unlike RewriteKeyspace, a provider key's
+// raw legacy suffix isn't an opaque blob: it's a CID followed by a peer
+// ID concatenated with no separator, and providers.providerDsKey's
+// on-disk layout length-prefixes the CID alone so the two can be split
+// back apart on load. rewriteProviders has to parse that split out of
+// each legacy key instead of just passing the raw bytes through
+// convertToDsKey, or the migrated keys would be undecodable.
+func RewriteProviderKeyspace(store ds.Datastore) (migrated int, err error) {
+	return rewriteProviders(store)
+}
+
+func rewrite(store ds.Datastore, namespace string) (int, error) {
+	results, err := store.Query(dsq.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var migrated int
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return migrated, entry.Error
+		}
+
+		oldKey := ds.NewKey(entry.Key)
+		raw, err := base32.RawStdEncoding.DecodeString(oldKey.BaseNamespace())
+		if err != nil {
+			// Not a legacy base32 key (could already be migrated); skip it.
+			continue
+		}
+
+		newKey := convertToDsKey(namespace, raw)
+		if err := store.Put(newKey, entry.Value); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+func rewriteProviders(store ds.Datastore) (int, error) {
+	results, err := store.Query(dsq.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	var migrated int
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return migrated, entry.Error
+		}
+
+		oldKey := ds.NewKey(entry.Key)
+		raw, err := base32.RawStdEncoding.DecodeString(oldKey.BaseNamespace())
+		if err != nil {
+			// Not a legacy base32 key (could already be migrated); skip it.
+			continue
+		}
+
+		n, c, err := cid.CidFromBytes(raw)
+		if err != nil {
+			// Not a CID-prefixed provider key; skip it rather than write
+			// something providers.decodeProviderDsKey can't parse back.
+			continue
+		}
+		peerIDBytes := raw[n:]
+
+		newKey := providerDsKey(c, peerIDBytes)
+		if err := store.Put(newKey, entry.Value); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// convertToDsKey duplicates dht.convertToDsKey's new encoding so this
+// tool has no import-cycle-inducing dependency on the dht package.
+func convertToDsKey(ns string, k []byte) ds.Key {
+	buf := make([]byte, 0, len(ns)+4+len(k))
+	buf = append(buf, ns...)
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(k)))
+	buf = append(buf, lenPrefix[:]...)
+	buf = append(buf, k...)
+
+	return ds.RawKey(string(buf))
+}
+
+// providerDsKey duplicates providers.providerDsKey's encoding (that
+// function is unexported, so it can't just be called here): the length
+// of c.Bytes() as a 4-byte big-endian prefix (the same prefix
+// convertToDsKey puts on its keys), then the raw CID bytes and then the
+// raw peer ID bytes. Keep
+// this in sync with providers.providerDsKey/decodeProviderDsKey.
+func providerDsKey(c cid.Cid, peerIDBytes []byte) ds.Key {
+	cidBytes := c.Bytes()
+
+	buf := make([]byte, 0, len(providersNamespace)+4+len(cidBytes)+len(peerIDBytes))
+	buf = append(buf, providersNamespace...)
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(cidBytes)))
+	buf = append(buf, lenPrefix[:]...)
+	buf = append(buf, cidBytes...)
+	buf = append(buf, peerIDBytes...)
+
+	return ds.RawKey(string(buf))
+}
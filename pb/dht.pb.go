@@ -0,0 +1,188 @@
+// Hand-written mirror of dht.proto: a plain Go struct plus getters, not
+// real protoc-gen-gogo output, so there's no Marshal/Unmarshal/Reset/
+// ProtoMessage here and nothing in this tree serializes a Message as
+// wire-format protobuf (see dht_net.go's gob-based codec and
+// ProtocolDHT, which is intentionally not the real /ipfs/kad/1.0.0
+// protocol ID because of that). Field additions
+// (providerSignatures/providerExpirations/closerPeerCount/status/
+// bulkKeys/bulkRecords) were added by hand for the S/Kademlia and
+// signed-provider-record work; keep dht.proto in sync if this is ever
+// regenerated for real.
+
+package pb
+
+import (
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+)
+
+type Message_MessageType int32
+
+const (
+	Message_PUT_VALUE     Message_MessageType = 0
+	Message_GET_VALUE     Message_MessageType = 1
+	Message_ADD_PROVIDER  Message_MessageType = 2
+	Message_GET_PROVIDERS Message_MessageType = 3
+	Message_FIND_NODE     Message_MessageType = 4
+	Message_PING          Message_MessageType = 5
+)
+
+var Message_MessageType_name = map[int32]string{
+	0: "PUT_VALUE",
+	1: "GET_VALUE",
+	2: "ADD_PROVIDER",
+	3: "GET_PROVIDERS",
+	4: "FIND_NODE",
+	5: "PING",
+}
+
+func (t Message_MessageType) String() string {
+	if name, ok := Message_MessageType_name[int32(t)]; ok {
+		return name
+	}
+	return "CUSTOM"
+}
+
+type Message_ConnectionType int32
+
+const (
+	Message_NOT_CONNECTED  Message_ConnectionType = 0
+	Message_CONNECTED      Message_ConnectionType = 1
+	Message_CAN_CONNECT    Message_ConnectionType = 2
+	Message_CANNOT_CONNECT Message_ConnectionType = 3
+)
+
+// Message_Status carries why a handler didn't answer normally, so a
+// well-behaved client can back off instead of hanging.
+type Message_Status int32
+
+const (
+	Message_OK           Message_Status = 0
+	Message_RATE_LIMITED Message_Status = 1
+)
+
+type Message_Peer struct {
+	Id         string
+	Addrs      [][]byte
+	Connection Message_ConnectionType
+}
+
+func (p *Message_Peer) GetId() string {
+	if p == nil {
+		return ""
+	}
+	return p.Id
+}
+
+func (p *Message_Peer) GetAddrs() [][]byte {
+	if p == nil {
+		return nil
+	}
+	return p.Addrs
+}
+
+type Message struct {
+	Type            Message_MessageType
+	ClusterLevelRaw int32
+	Key             []byte
+	Record          *recpb.Record
+	CloserPeers     []*Message_Peer
+	ProviderPeers   []*Message_Peer
+
+	// ProviderSignatures and ProviderExpirations are parallel to
+	// ProviderPeers by index: signature/expiration for providerPeers[i].
+	ProviderSignatures  [][]byte
+	ProviderExpirations []int64
+
+	// CloserPeerCount overrides CloserPeerCount (the package-level
+	// default) for a single request, e.g. a disjoint-path lookup hop.
+	CloserPeerCount int32
+
+	Status Message_Status
+
+	BulkKeys    [][]byte
+	BulkRecords []*recpb.Record
+}
+
+func (m *Message) GetType() Message_MessageType {
+	if m == nil {
+		return Message_PUT_VALUE
+	}
+	return m.Type
+}
+
+func (m *Message) GetClusterLevelRaw() int32 {
+	if m == nil {
+		return 0
+	}
+	return m.ClusterLevelRaw
+}
+
+func (m *Message) GetKey() []byte {
+	if m == nil {
+		return nil
+	}
+	return m.Key
+}
+
+func (m *Message) GetRecord() *recpb.Record {
+	if m == nil {
+		return nil
+	}
+	return m.Record
+}
+
+func (m *Message) GetCloserPeers() []*Message_Peer {
+	if m == nil {
+		return nil
+	}
+	return m.CloserPeers
+}
+
+func (m *Message) GetProviderPeers() []*Message_Peer {
+	if m == nil {
+		return nil
+	}
+	return m.ProviderPeers
+}
+
+func (m *Message) GetProviderSignatures() [][]byte {
+	if m == nil {
+		return nil
+	}
+	return m.ProviderSignatures
+}
+
+func (m *Message) GetProviderExpirations() []int64 {
+	if m == nil {
+		return nil
+	}
+	return m.ProviderExpirations
+}
+
+func (m *Message) GetCloserPeerCount() int32 {
+	if m == nil {
+		return 0
+	}
+	return m.CloserPeerCount
+}
+
+func (m *Message) GetStatus() Message_Status {
+	if m == nil {
+		return Message_OK
+	}
+	return m.Status
+}
+
+func (m *Message) GetBulkKeys() [][]byte {
+	if m == nil {
+		return nil
+	}
+	return m.BulkKeys
+}
+
+func (m *Message) GetBulkRecords() []*recpb.Record {
+	if m == nil {
+		return nil
+	}
+	return m.BulkRecords
+}
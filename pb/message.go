@@ -0,0 +1,87 @@
+package pb
+
+import (
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// NewMessage builds a response/request of type t for key, at the given
+// cluster level. level is stored off by one (see GetClusterLevel) so the
+// zero value of ClusterLevelRaw means "not set" rather than "level 0".
+func NewMessage(t Message_MessageType, key []byte, level int) *Message {
+	m := &Message{Type: t, Key: key}
+	m.SetClusterLevel(level)
+	return m
+}
+
+// GetClusterLevel returns the message's cluster level, or 0 if unset.
+func (m *Message) GetClusterLevel() int {
+	level := m.GetClusterLevelRaw() - 1
+	if level < 0 {
+		return 0
+	}
+	return level
+}
+
+// SetClusterLevel sets the message's cluster level.
+func (m *Message) SetClusterLevel(level int) {
+	m.ClusterLevelRaw = int32(level + 1)
+}
+
+// PBPeersToPeerInfos converts the wire representation of a peer list
+// into the core peer.AddrInfo type, dropping any peer whose ID doesn't
+// parse.
+func PBPeersToPeerInfos(pbps []*Message_Peer) []peer.AddrInfo {
+	peers := make([]peer.AddrInfo, 0, len(pbps))
+	for _, p := range pbps {
+		pid, err := peer.IDFromBytes([]byte(p.GetId()))
+		if err != nil {
+			continue
+		}
+
+		addrs := make([]ma.Multiaddr, 0, len(p.GetAddrs()))
+		for _, a := range p.GetAddrs() {
+			addr, err := ma.NewMultiaddrBytes(a)
+			if err != nil {
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+
+		peers = append(peers, peer.AddrInfo{ID: pid, Addrs: addrs})
+	}
+	return peers
+}
+
+// PeerInfosToPBPeers converts core peer.AddrInfo values into their wire
+// representation, annotating each with net's current connectedness.
+func PeerInfosToPBPeers(net network.Network, infos []peer.AddrInfo) []*Message_Peer {
+	peers := make([]*Message_Peer, 0, len(infos))
+	for _, info := range infos {
+		addrs := make([][]byte, 0, len(info.Addrs))
+		for _, a := range info.Addrs {
+			addrs = append(addrs, a.Bytes())
+		}
+
+		peers = append(peers, &Message_Peer{
+			Id:         string(info.ID),
+			Addrs:      addrs,
+			Connection: connectionType(net, info.ID),
+		})
+	}
+	return peers
+}
+
+func connectionType(net network.Network, p peer.ID) Message_ConnectionType {
+	switch net.Connectedness(p) {
+	case network.Connected:
+		return Message_CONNECTED
+	case network.CanConnect:
+		return Message_CAN_CONNECT
+	case network.CannotConnect:
+		return Message_CANNOT_CONNECT
+	default:
+		return Message_NOT_CONNECTED
+	}
+}
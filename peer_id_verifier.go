@@ -0,0 +1,47 @@
+package dht
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+)
+
+// ErrPeerIDMismatch is returned by PeerIDVerifier when a peer ID and its
+// claimed public key don't match.
+var ErrPeerIDMismatch = errors.New("peer ID is not the hash of the given public key")
+
+// PeerIDVerifier checks that a peer ID offered in a lookup response is
+// actually derived from the public key it's paired with, the same way
+// peer.IDFromPublicKey does it. Lookup code should run every peer it's
+// about to add to its frontier through this before trusting it, so that
+// a malicious peer in the response set can't hand out IDs it doesn't
+// control the private key for.
+type PeerIDVerifier func(p peer.ID) error
+
+// DefaultPeerIDVerifier verifies p against the public key held for it in
+// ps, if any. Most peers surfacing in a lookup response are ones we've
+// never dialed, so there's nothing in ps to check yet; that's not by
+// itself suspicious, and is accepted. Only a public key that's on file
+// and doesn't hash to p is rejected.
+func DefaultPeerIDVerifier(ps peerstore.KeyBook) PeerIDVerifier {
+	return func(p peer.ID) error {
+		pubk, err := ps.PubKey(p)
+		if err != nil || pubk == nil {
+			// Same "no key on file, can't verify" case handlers.go treats
+			// PubKey's error and nil-result as: a fresh peer we've never
+			// dialed has nothing in ps yet, and that's not by itself
+			// suspicious.
+			return nil
+		}
+
+		expected, err := peer.IDFromPublicKey(pubk)
+		if err != nil {
+			return err
+		}
+		if expected != p {
+			return ErrPeerIDMismatch
+		}
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package dht
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func testCID(t *testing.T) cid.Cid {
+	t.Helper()
+	h, err := mh.Sum([]byte("hello"), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestProviderRecordSignRoundTrip(t *testing.T) {
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testCID(t)
+	addrs := [][]byte{[]byte("/ip4/1.2.3.4/tcp/4001")}
+	exp := int64(1700000000)
+
+	sig, err := signProviderRecord(sk, c, p, addrs, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := verifyProviderRecord(pk, c, p, addrs, exp, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected signature to verify")
+	}
+}
+
+func TestProviderRecordSignRejectsTamperedExpiration(t *testing.T) {
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testCID(t)
+	addrs := [][]byte{[]byte("/ip4/1.2.3.4/tcp/4001")}
+
+	sig, err := signProviderRecord(sk, c, p, addrs, 1700000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, _ := verifyProviderRecord(pk, c, p, addrs, 1800000000, sig)
+	if ok {
+		t.Fatal("expected signature over a different expiration to fail verification")
+	}
+}
@@ -0,0 +1,139 @@
+package dht
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+)
+
+// provideAnnouncePaths bounds how many independent S/Kademlia paths
+// announceProvider walks via GetClosestPeersDisjoint to find the peers
+// it tells about a newly (re-)Provided CID.
+const provideAnnouncePaths = 4
+
+// MinProviderTTL and MaxProviderTTL bound how long a single provider
+// record may be advertised for. Content behind a short-lived pubsub
+// topic and content meant to live for the life of the node both flow
+// through the same AddProvider path, so the bounds have to be wide
+// enough for both while still keeping a misbehaving peer from pinning a
+// record in our datastore indefinitely.
+const (
+	MinProviderTTL = 5 * time.Minute
+	MaxProviderTTL = 48 * time.Hour
+
+	// DefaultProviderTTL is used by Provide when the caller doesn't have
+	// an opinion on how long their content should stay advertised.
+	DefaultProviderTTL = ProviderAddrTTLFallback
+	// ProviderAddrTTLFallback mirrors the provider record lifetime this
+	// package used before explicit per-record TTLs existed.
+	ProviderAddrTTLFallback = 24 * time.Hour
+)
+
+// clampProviderExpiration bounds an absolute unix expiration timestamp
+// so it falls within [MinProviderTTL, MaxProviderTTL] of now.
+func clampProviderExpiration(expiration int64) int64 {
+	now := time.Now()
+	min := now.Add(MinProviderTTL).Unix()
+	max := now.Add(MaxProviderTTL).Unix()
+
+	switch {
+	case expiration < min:
+		return min
+	case expiration > max:
+		return max
+	default:
+		return expiration
+	}
+}
+
+// filterExpiredProviders drops any provider whose stored record has
+// already expired, returning the surviving providers alongside their
+// signatures and expirations, in the same order as the providers
+// argument.
+func (dht *IpfsDHT) filterExpiredProviders(ctx context.Context, c cid.Cid, providers []peer.ID) (kept []peer.ID, sigs [][]byte, exps []int64) {
+	allSigs, allExps := dht.providers.GetProviderRecordMeta(ctx, c, providers)
+	now := time.Now().Unix()
+
+	for i, p := range providers {
+		var exp int64
+		if i < len(allExps) {
+			exp = allExps[i]
+		}
+		if exp != 0 && exp < now {
+			logger.Debugf("%s dropping expired provider %s for %s", dht.self, p, c)
+			continue
+		}
+
+		kept = append(kept, p)
+		if i < len(allSigs) {
+			sigs = append(sigs, allSigs[i])
+		} else {
+			sigs = append(sigs, nil)
+		}
+		exps = append(exps, exp)
+	}
+
+	return kept, sigs, exps
+}
+
+// ProvideWithTTL advertises the local peer as a provider of c for ttl,
+// signing the provider record with the local private key. Applications
+// that know their content is short-lived (e.g. a pubsub topic) should
+// pass a short ttl rather than relying on DefaultProviderTTL, since a
+// shorter TTL means the record is garbage collected, and stops being
+// handed out by other nodes, sooner after the application stops caring
+// about it. Provide calls this with DefaultProviderTTL.
+func (dht *IpfsDHT) ProvideWithTTL(ctx context.Context, c cid.Cid, ttl time.Duration) error {
+	if ttl < MinProviderTTL {
+		ttl = MinProviderTTL
+	} else if ttl > MaxProviderTTL {
+		ttl = MaxProviderTTL
+	}
+
+	expiration := time.Now().Add(ttl).Unix()
+	addrs := dht.peerstore.Addrs(dht.self)
+	addrBytes := make([][]byte, len(addrs))
+	for i, a := range addrs {
+		addrBytes[i] = a.Bytes()
+	}
+
+	sig, err := signProviderRecord(dht.peerstore.PrivKey(dht.self), c, dht.self, addrBytes, expiration)
+	if err != nil {
+		return err
+	}
+
+	dht.providers.AddProvider(ctx, c, dht.self, sig, expiration)
+	dht.republisher.track(c, ttl)
+
+	dht.announceProvider(ctx, c, sig, expiration)
+	return nil
+}
+
+// announceProvider tells the peers closest to c's key, found the same
+// way a disjoint FIND_NODE lookup finds them, that dht.self provides c,
+// by sending each a signed ADD_PROVIDER. A lookup or send failure is
+// logged and otherwise ignored: by the time this runs, Provide/
+// ProvideWithTTL has already durably recorded the local provider record
+// and scheduled its republish, so a network hiccup here just makes this
+// round's announcement thin rather than failing Provide outright.
+func (dht *IpfsDHT) announceProvider(ctx context.Context, c cid.Cid, sig []byte, expiration int64) {
+	peers, err := dht.GetClosestPeersDisjoint(ctx, c.KeyString(), provideAnnouncePaths)
+	if err != nil {
+		logger.Debugf("%s could not find peers to announce %s to: %s", dht.self, c, err)
+		return
+	}
+
+	req := pb.NewMessage(pb.Message_ADD_PROVIDER, c.Bytes(), 0)
+	req.ProviderPeers = pb.PeerInfosToPBPeers(dht.host.Network(), []peer.AddrInfo{{ID: dht.self, Addrs: dht.peerstore.Addrs(dht.self)}})
+	req.ProviderSignatures = [][]byte{sig}
+	req.ProviderExpirations = []int64{expiration}
+
+	for _, p := range peers {
+		if _, err := dht.sendRequest(ctx, p, req); err != nil {
+			logger.Debugf("%s failed to announce itself as a provider of %s to %s: %s", dht.self, c, p, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package dht
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClampProviderExpiration(t *testing.T) {
+	now := time.Now()
+
+	tooSoon := now.Add(time.Minute).Unix()
+	if got := clampProviderExpiration(tooSoon); got < now.Add(MinProviderTTL).Unix() {
+		t.Fatalf("clampProviderExpiration(%d) = %d, want >= MinProviderTTL from now", tooSoon, got)
+	}
+
+	tooLate := now.Add(72 * time.Hour).Unix()
+	if got := clampProviderExpiration(tooLate); got > now.Add(MaxProviderTTL).Unix()+1 {
+		t.Fatalf("clampProviderExpiration(%d) = %d, want <= MaxProviderTTL from now", tooLate, got)
+	}
+
+	inRange := now.Add(time.Hour).Unix()
+	if got := clampProviderExpiration(inRange); got != inRange {
+		t.Fatalf("clampProviderExpiration(%d) = %d, want unchanged", inRange, got)
+	}
+}
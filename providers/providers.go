@@ -0,0 +1,208 @@
+// Package providers implements the ProviderManager used by
+// IpfsDHT.handleAddProvider/handleGetProviders to track which peers have
+// announced they provide a given CID.
+package providers
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// providersNamespace mirrors dht.ProvidersNamespace. It's duplicated
+// rather than imported to avoid an import cycle (the dht package imports
+// this one); migrate.go duplicates the same encoding for the same
+// reason.
+const providersNamespace = "/providers/"
+
+// record is what's persisted per (CID, provider) pair.
+type record struct {
+	Signature  []byte
+	Expiration int64
+}
+
+// ProviderManager is the interface handlers.go depends on; it's kept
+// narrow so alternative storage backends can be swapped in under test.
+type ProviderManager interface {
+	AddProvider(ctx context.Context, c cid.Cid, p peer.ID, sig []byte, expiration int64)
+	GetProviders(ctx context.Context, c cid.Cid) []peer.ID
+	// GetProviderRecordMeta returns, for each of peers (in the same
+	// order), the signature and expiration on file for that peer's
+	// record of c. A peer we have no record for gets a nil/0 entry.
+	GetProviderRecordMeta(ctx context.Context, c cid.Cid, peers []peer.ID) (sigs [][]byte, expirations []int64)
+}
+
+// dsProviderManager is the default ProviderManager, backed by a
+// datastore namespaced the same way the DHT's own record keyspace is
+// (see dht.convertToDsKey): /providers/<4-byte length><CID bytes><peer ID bytes>.
+type dsProviderManager struct {
+	mu     sync.RWMutex
+	dstore ds.Datastore
+	cache  map[string]map[peer.ID]record
+}
+
+// NewProviderManager constructs a ProviderManager backed by dstore,
+// loading whatever provider records are already on disk so a restart
+// doesn't silently forget signatures and expirations AddProvider
+// persisted before the process exited.
+func NewProviderManager(self peer.ID, dstore ds.Datastore) ProviderManager {
+	pm := &dsProviderManager{dstore: dstore, cache: make(map[string]map[peer.ID]record)}
+	pm.loadFromDatastore()
+	return pm
+}
+
+// loadFromDatastore populates pm.cache from dstore's /providers/ keyspace.
+// Entries that fail to decode (e.g. left over from a keyspace this
+// version no longer writes) or that have already expired are skipped
+// rather than surfaced as a constructor error, since NewProviderManager
+// has no way to report one.
+func (pm *dsProviderManager) loadFromDatastore() {
+	results, err := pm.dstore.Query(dsq.Query{Prefix: providersNamespace})
+	if err != nil {
+		return
+	}
+	defer results.Close()
+
+	now := time.Now().Unix()
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			continue
+		}
+
+		c, p, err := decodeProviderDsKey(entry.Key)
+		if err != nil {
+			continue
+		}
+		sig, expiration := decodeRecord(entry.Value)
+		if expiration != 0 && expiration < now {
+			continue
+		}
+
+		byPeer, ok := pm.cache[c.KeyString()]
+		if !ok {
+			byPeer = make(map[peer.ID]record)
+			pm.cache[c.KeyString()] = byPeer
+		}
+		byPeer[p] = record{Signature: sig, Expiration: expiration}
+	}
+}
+
+func (pm *dsProviderManager) AddProvider(ctx context.Context, c cid.Cid, p peer.ID, sig []byte, expiration int64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	byPeer, ok := pm.cache[c.KeyString()]
+	if !ok {
+		byPeer = make(map[peer.ID]record)
+		pm.cache[c.KeyString()] = byPeer
+	}
+	byPeer[p] = record{Signature: sig, Expiration: expiration}
+	_ = pm.dstore.Put(providerDsKey(c, p), encodeRecord(sig, expiration))
+}
+
+func (pm *dsProviderManager) GetProviders(ctx context.Context, c cid.Cid) []peer.ID {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	byPeer := pm.cache[c.KeyString()]
+	now := time.Now().Unix()
+	peers := make([]peer.ID, 0, len(byPeer))
+	for p, rec := range byPeer {
+		if rec.Expiration != 0 && rec.Expiration < now {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (pm *dsProviderManager) GetProviderRecordMeta(ctx context.Context, c cid.Cid, peers []peer.ID) ([][]byte, []int64) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	byPeer := pm.cache[c.KeyString()]
+	sigs := make([][]byte, len(peers))
+	exps := make([]int64, len(peers))
+	for i, p := range peers {
+		if rec, ok := byPeer[p]; ok {
+			sigs[i] = rec.Signature
+			exps[i] = rec.Expiration
+		}
+	}
+	return sigs, exps
+}
+
+// encodeRecord packs a provider record as an 8-byte big-endian
+// expiration followed by the raw signature bytes.
+func encodeRecord(sig []byte, expiration int64) []byte {
+	buf := make([]byte, 8, 8+len(sig))
+	binary.BigEndian.PutUint64(buf, uint64(expiration))
+	return append(buf, sig...)
+}
+
+// decodeRecord is encodeRecord's inverse, used to repopulate pm.cache
+// from dstore on construction. A buf too short to hold the expiration
+// is treated as an unsigned record with no expiration, the same as a
+// zero-value record.
+func decodeRecord(buf []byte) (sig []byte, expiration int64) {
+	if len(buf) < 8 {
+		return nil, 0
+	}
+	expiration = int64(binary.BigEndian.Uint64(buf[:8]))
+	if len(buf) > 8 {
+		sig = buf[8:]
+	}
+	return sig, expiration
+}
+
+// providerDsKey builds the on-disk key for (c, p): providersNamespace,
+// followed by the length of c.Bytes() as a 4-byte big-endian prefix (the
+// same prefix dht.convertToDsKey puts on its own keys), then the raw
+// CID bytes and then the raw peer ID bytes. The length prefix is what
+// lets decodeProviderDsKey split c back out from p on load, since
+// neither is self-delimiting on its own.
+func providerDsKey(c cid.Cid, p peer.ID) ds.Key {
+	cidBytes := c.Bytes()
+
+	buf := make([]byte, 0, len(providersNamespace)+4+len(cidBytes)+len(p))
+	buf = append(buf, providersNamespace...)
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(cidBytes)))
+	buf = append(buf, lenPrefix[:]...)
+	buf = append(buf, cidBytes...)
+	buf = append(buf, []byte(p)...)
+
+	return ds.RawKey(string(buf))
+}
+
+// decodeProviderDsKey is providerDsKey's inverse.
+func decodeProviderDsKey(key string) (cid.Cid, peer.ID, error) {
+	if len(key) < len(providersNamespace)+4 || key[:len(providersNamespace)] != providersNamespace {
+		return cid.Undef, "", fmt.Errorf("providers: key %q missing %s prefix", key, providersNamespace)
+	}
+	rest := key[len(providersNamespace):]
+
+	cidLen := binary.BigEndian.Uint32([]byte(rest[:4]))
+	rest = rest[4:]
+	if uint64(len(rest)) < uint64(cidLen) {
+		return cid.Undef, "", fmt.Errorf("providers: key %q has a truncated CID", key)
+	}
+
+	c, err := cid.Cast([]byte(rest[:cidLen]))
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	p, err := peer.IDFromBytes([]byte(rest[cidLen:]))
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	return c, p, nil
+}
@@ -0,0 +1,120 @@
+package dht
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// republishSafetyMargin is how long before a provider record's TTL
+// elapses that the republisher re-Provides it, so the record never
+// actually lapses even if the republish loop is running a little late.
+// It only applies as-is to records whose ttl leaves room for it;
+// republishDelay scales it down for anything shorter.
+const republishSafetyMargin = 10 * time.Minute
+
+// republishDelay returns how long after being tracked with the given ttl
+// a provider record should be re-Provided. For most records that's
+// republishSafetyMargin before ttl elapses, but republishSafetyMargin is
+// longer than MinProviderTTL itself, so for a short ttl it's scaled down
+// to half of ttl instead, keeping the due time in the future (and ahead
+// of the record actually lapsing) no matter how short ttl is.
+func republishDelay(ttl time.Duration) time.Duration {
+	margin := republishSafetyMargin
+	if half := ttl / 2; margin > half {
+		margin = half
+	}
+	return ttl - margin
+}
+
+// republishEntry is the TTL a CID was last Provide'd with and when it is
+// next due to be re-Provided.
+type republishEntry struct {
+	ttl time.Duration
+	due time.Time
+}
+
+// provideRepublisher re-Provides every CID this node has Provide'd,
+// shortly before its record's TTL would otherwise expire, so long-running
+// nodes don't silently stop advertising content they're still serving.
+type provideRepublisher struct {
+	mu      sync.Mutex
+	entries map[cid.Cid]republishEntry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	dht    *IpfsDHT
+}
+
+func newProvideRepublisher(dht *IpfsDHT) *provideRepublisher {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &provideRepublisher{
+		entries: make(map[cid.Cid]republishEntry),
+		ctx:     ctx,
+		cancel:  cancel,
+		dht:     dht,
+	}
+	go r.run()
+	return r
+}
+
+// track records that c was just Provide'd with the given ttl, so the
+// republish loop knows to come back for it shortly before it lapses.
+func (r *provideRepublisher) track(c cid.Cid, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := time.Now().Add(republishDelay(ttl))
+	r.entries[c] = republishEntry{ttl: ttl, due: due}
+}
+
+// Close stops the republish loop.
+func (r *provideRepublisher) Close() {
+	r.cancel()
+}
+
+func (r *provideRepublisher) run() {
+	// Wake up often enough to catch the shortest TTL anyone is using
+	// (MinProviderTTL) at its own republishDelay, the soonest any entry
+	// can come due.
+	interval := republishDelay(MinProviderTTL)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.republishDue()
+		}
+	}
+}
+
+func (r *provideRepublisher) republishDue() {
+	now := time.Now()
+
+	r.mu.Lock()
+	due := make(map[cid.Cid]time.Duration)
+	for c, entry := range r.entries {
+		if !now.Before(entry.due) {
+			due[c] = entry.ttl
+		}
+	}
+	r.mu.Unlock()
+
+	for c, ttl := range due {
+		// ProvideWithTTL re-tracks c with a fresh due time on success, so a
+		// failed republish is retried on the next tick instead of being
+		// silently dropped from the schedule.
+		if err := r.dht.ProvideWithTTL(r.ctx, c, ttl); err != nil {
+			logger.Debugf("%s failed to republish provider record for %s: %s", r.dht.self, c, err)
+		}
+	}
+}
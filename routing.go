@@ -0,0 +1,43 @@
+package dht
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	pb "github.com/lukesolo/go-libp2p-kad-dht/pb"
+)
+
+// Provide satisfies routing.ContentRouting: it adds c to our own
+// provider set, and if brdcst is true also announces it to the network
+// with DefaultProviderTTL and schedules it for auto-republishing.
+// Callers that want a non-default lifetime should use ProvideWithTTL.
+func (dht *IpfsDHT) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if !brdcst {
+		dht.providers.AddProvider(ctx, c, dht.self, nil, 0)
+		return nil
+	}
+	return dht.ProvideWithTTL(ctx, c, DefaultProviderTTL)
+}
+
+// findPeerSingle sends a single FIND_NODE for key to p, asking for
+// closerPeerCount candidates via the per-message override so a disjoint
+// lookup path can request more than CloserPeerCount per hop.
+func (dht *IpfsDHT) findPeerSingle(ctx context.Context, p peer.ID, key string, closerPeerCount int) ([]peer.ID, error) {
+	req := pb.NewMessage(pb.Message_FIND_NODE, []byte(key), 0)
+	req.CloserPeerCount = int32(closerPeerCount)
+
+	resp, err := dht.sendRequest(ctx, p, req)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := pb.PBPeersToPeerInfos(resp.GetCloserPeers())
+	peers := make([]peer.ID, len(infos))
+	for i, info := range infos {
+		dht.peerstore.AddAddrs(info.ID, info.Addrs, peerstore.TempAddrTTL)
+		peers[i] = info.ID
+	}
+	return peers, nil
+}
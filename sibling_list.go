@@ -0,0 +1,99 @@
+package dht
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+)
+
+// DefaultSiblingListSize is the default size of the S/Kademlia sibling
+// list (commonly called "s" in the paper), kept separate from KValue so
+// the two can be tuned independently.
+const DefaultSiblingListSize = 16
+
+// siblingList tracks the s peers numerically closest to the local peer,
+// independent of which k-bucket they happen to fall in. Unlike the
+// k-bucket table, which only ever keeps a handful of peers per bucket,
+// the sibling list is used to give lookups for keys very close to us a
+// much denser view of our own neighbourhood, which is what lets
+// GetClosestPeersDisjoint seed a path with peers a single eclipsed
+// bucket can't account for.
+type siblingList struct {
+	mu   sync.RWMutex
+	self peer.ID
+	size int
+	ids  []peer.ID
+}
+
+func newSiblingList(self peer.ID, size int) *siblingList {
+	if size <= 0 {
+		size = DefaultSiblingListSize
+	}
+	return &siblingList{self: self, size: size}
+}
+
+// Add considers p for inclusion in the sibling list, evicting the
+// farthest member if the list is already full.
+func (sl *siblingList) Add(p peer.ID) {
+	if p == sl.self {
+		return
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	for _, existing := range sl.ids {
+		if existing == p {
+			return
+		}
+	}
+
+	sl.ids = append(sl.ids, p)
+	sort.Slice(sl.ids, func(i, j int) bool {
+		return kb.Closer(sl.self, sl.ids[i], sl.ids[j])
+	})
+
+	if len(sl.ids) > sl.size {
+		sl.ids = sl.ids[:sl.size]
+	}
+}
+
+// Remove drops p from the sibling list, if present.
+func (sl *siblingList) Remove(p peer.ID) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	for i, existing := range sl.ids {
+		if existing == p {
+			sl.ids = append(sl.ids[:i], sl.ids[i+1:]...)
+			return
+		}
+	}
+}
+
+// Peers returns a snapshot of the current sibling list, closest first.
+func (sl *siblingList) Peers() []peer.ID {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	out := make([]peer.ID, len(sl.ids))
+	copy(out, sl.ids)
+	return out
+}
+
+// Covers reports whether target falls within the sibling range: the
+// sibling list is full and target is closer to self than the farthest
+// sibling we currently track. When it does, handleFindPeer should answer
+// from the sibling list rather than the (coarser) k-bucket table.
+func (sl *siblingList) Covers(target peer.ID) bool {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	if len(sl.ids) < sl.size {
+		return false
+	}
+	farthest := sl.ids[len(sl.ids)-1]
+	return kb.Closer(sl.self, target, farthest)
+}
@@ -0,0 +1,43 @@
+package dht
+
+// Validator determines whether a record (keyed by a DHT key) is valid,
+// and picks the "best" of several candidate values for the same key
+// (e.g. by sequence number). ValidateBytes/SelectBytes are the raw-key
+// equivalents of Validate/Select, added so callers on the []byte key
+// path (see keys.go) don't need a string conversion at every call site.
+type Validator interface {
+	Validate(key string, value []byte) error
+	Select(key string, values [][]byte) (int, error)
+
+	ValidateBytes(key []byte, value []byte) error
+	SelectBytes(key []byte, values [][]byte) (int, error)
+}
+
+// BytesValidator adapts an existing string-keyed Validator (e.g.
+// record.Validator or a NamespacedValidator) to the Validator interface
+// above by deriving ValidateBytes/SelectBytes from Validate/Select,
+// converting the key with a plain string(key) since that conversion is
+// free. Wrap an existing validator with this instead of reimplementing
+// the Bytes methods.
+type BytesValidator struct {
+	Validator interface {
+		Validate(key string, value []byte) error
+		Select(key string, values [][]byte) (int, error)
+	}
+}
+
+func (v BytesValidator) Validate(key string, value []byte) error {
+	return v.Validator.Validate(key, value)
+}
+
+func (v BytesValidator) Select(key string, values [][]byte) (int, error) {
+	return v.Validator.Select(key, values)
+}
+
+func (v BytesValidator) ValidateBytes(key []byte, value []byte) error {
+	return v.Validator.Validate(string(key), value)
+}
+
+func (v BytesValidator) SelectBytes(key []byte, values [][]byte) (int, error) {
+	return v.Validator.Select(string(key), values)
+}